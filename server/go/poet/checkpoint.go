@@ -0,0 +1,134 @@
+package poet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// checkpointSuffix names the sidecar file ConstructDagContext writes next
+// to the label store every CheckpointInterval nodes, so a process killed
+// mid-build — PoET runs can take weeks — can resume instead of starting
+// over.
+const checkpointSuffix = ".poet.checkpoint"
+
+// checkpointState is the sidecar's contents, varint/length-prefix encoded
+// with encodeVarint/encodeBytes (see encoding.go) — the same amino-free
+// scheme IAVL uses for its node format.
+type checkpointState struct {
+	Commitment         []byte
+	HashAlgo           string
+	Height             uint64
+	LastCompletedIndex uint64
+	// PartialRootState is l0 || l1, the two root-input labels
+	// ConstructDagContext hashes together for the final root, captured by
+	// the first checkpoint taken after both are durably written. It's
+	// empty until then. Resuming
+	// with it set lets ConstructDagContext skip recomputing l0/l1 through
+	// ComputeLabel's cold post-restart cache.
+	PartialRootState []byte
+}
+
+func checkpointPath(labelPath string) string {
+	return labelPath + checkpointSuffix
+}
+
+// writeCheckpoint atomically replaces path's contents via a rename, so a
+// reader such as ResumeProver never observes a half-written checkpoint.
+// Concurrent writers share the same ".tmp" file and are not guarded
+// against each other.
+func writeCheckpoint(path string, state checkpointState) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	buf = append(buf, encodeBytes(state.Commitment)...)
+	buf = append(buf, encodeBytes([]byte(state.HashAlgo))...)
+	buf = append(buf, encodeVarint(state.Height)...)
+	buf = append(buf, encodeVarint(state.LastCompletedIndex)...)
+	buf = append(buf, encodeBytes(state.PartialRootState)...)
+
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readCheckpoint(path string) (checkpointState, error) {
+	var state checkpointState
+
+	file, err := os.Open(path)
+	if err != nil {
+		return state, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	if state.Commitment, err = readBytes(r); err != nil {
+		return state, err
+	}
+	algo, err := readBytes(r)
+	if err != nil {
+		return state, err
+	}
+	state.HashAlgo = string(algo)
+	if state.Height, err = readVarint(r); err != nil {
+		return state, err
+	}
+	if state.LastCompletedIndex, err = readVarint(r); err != nil {
+		return state, err
+	}
+	if state.PartialRootState, err = readBytes(r); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// ResumeProver reopens a label store a prior process left mid-construction
+// and validates it against the sidecar checkpoint next to it, returning a
+// Prover whose next ConstructDagContext call picks up at
+// lastCompletedIndex+1 instead of starting over.
+func ResumeProver(path string) (*Prover, error) {
+	state, err := readCheckpoint(checkpointPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("poet: reading checkpoint: %w", err)
+	}
+
+	store, err := reopenLabelStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("poet: reopening label store: %w", err)
+	}
+
+	if store.NodeCount() != uint64(len(planDag())) {
+		store.Close()
+		return nil, errors.New("poet: label store's dag size doesn't match the current m/n/t constants")
+	}
+	if state.Height != uint64(m) || state.LastCompletedIndex >= store.NodeCount() {
+		store.Close()
+		return nil, errors.New("poet: checkpoint doesn't match the label store it sits next to")
+	}
+
+	p := NewProver(false)
+	p.labelStore = store
+	p.resumeState = &state
+	return p, nil
+}
+
+// Progress reports how many of the current (or most recently finished)
+// ConstructDag(Context) call's labels have been written.
+func (p *Prover) Progress() (done, total uint64) {
+	return atomic.LoadUint64(&p.progressDone), atomic.LoadUint64(&p.progressTotal)
+}
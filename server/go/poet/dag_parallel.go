@@ -0,0 +1,328 @@
+package poet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Options configures how ConstructDag builds the proof DAG. The zero value
+// is valid: missing fields fall back to DefaultOptions.
+type Options struct {
+	// Parallelism is the number of concurrent label-hashing workers.
+	// Defaults to runtime.NumCPU() when <= 0.
+	Parallelism int
+	// BufferSize is the depth of the channel feeding nodes to the hash
+	// workers and of the channel reporting their completed indices to the
+	// checkpoint tracker. Defaults to 200 when <= 0.
+	BufferSize int
+}
+
+// DefaultOptions returns the Options ConstructDag uses when none are given.
+func DefaultOptions() Options {
+	return Options{
+		Parallelism: runtime.NumCPU(),
+		BufferSize:  200,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	if o.Parallelism <= 0 {
+		o.Parallelism = runtime.NumCPU()
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = 200
+	}
+	return o
+}
+
+// dagNode is a single node of the DAG to be labeled, tagged with the BFS
+// position it must be written at so the resulting label file stays
+// byte-identical to the one produced by serial construction.
+type dagNode struct {
+	index     int
+	id        *BinaryID
+	isRootL   bool
+	isRootR   bool
+}
+
+// planDag walks the same height/level nesting as the original serial
+// implementation and returns the full, ordered list of nodes to label.
+// Keeping the enumeration in one place guarantees the parallel and serial
+// paths agree on BFS order.
+func planDag() []dagNode {
+	var nodes []dagNode
+	index := 0
+	for height := 0; height < (m + 1); height++ {
+		numberOfNodes := 1 << uint(height)
+
+		for level := 0; level < numberOfNodes; level++ {
+			leftID, _ := NewBinaryID(uint(height), level)
+			leftID.AddBit(0)
+			nodes = append(nodes, dagNode{
+				index:   index,
+				id:      leftID,
+				isRootL: height == 1 && level == numberOfNodes-1,
+			})
+			index++
+		}
+
+		for level := 0; level < numberOfNodes; level++ {
+			rightID, _ := NewBinaryID(uint(height), level)
+			rightID.AddBit(1)
+			nodes = append(nodes, dagNode{
+				index:   index,
+				id:      rightID,
+				isRootR: height == 1 && level == numberOfNodes-1,
+			})
+			index++
+		}
+	}
+	return nodes
+}
+
+// ConstructDag creates the proof DAG and returns its root hash phi. It is
+// equivalent to ConstructDagContext(context.Background(), commitment, hash,
+// Options{}).
+func (p *Prover) ConstructDag(commitment []byte, hash HashFunc) ([]byte, error) {
+	return p.ConstructDagContext(context.Background(), commitment, hash, Options{})
+}
+
+// ConstructDagContext builds the DAG using a bounded pool of hash workers
+// that fan out ComputeLabel calls. ComputeLabel itself dedupes concurrent
+// work through the Prover's in-flight map and shared LRU cache, so a parent shared by
+// several children is only hashed once no matter which worker reaches it
+// first. Labels are committed to a LabelStore, whose fixed-width records
+// can be written out of order and later read back with a single pread, so
+// the workers write directly rather than funneling through a single
+// writer goroutine.
+//
+// If p.CheckpointInterval is set, progress is checkpointed to a sidecar
+// file every CheckpointInterval labels, and once more when ctx is
+// cancelled, before returning ctx.Err() — so deriving ctx from
+// signal.NotifyContext lets a SIGTERM checkpoint cleanly instead of
+// losing the in-flight build. A Prover returned by ResumeProver picks up
+// right after its checkpoint's LastCompletedIndex instead of starting
+// over.
+func (p *Prover) ConstructDagContext(ctx context.Context, commitment []byte, hash HashFunc, opts Options) ([]byte, error) {
+	opts = opts.withDefaults()
+
+	nodes := planDag()
+	if len(nodes) == 0 {
+		return nil, errors.New("poet: empty dag")
+	}
+	atomic.StoreUint64(&p.progressTotal, uint64(len(nodes)))
+
+	var rootLIndex, rootRIndex int
+	for _, node := range nodes {
+		switch {
+		case node.isRootL:
+			rootLIndex = node.index
+		case node.isRootR:
+			rootRIndex = node.index
+		}
+	}
+
+	store := p.labelStore
+	resuming := p.resumeState != nil
+	startAt := 0
+	var resumedPartialRoot []byte
+	if resuming {
+		startAt = int(p.resumeState.LastCompletedIndex) + 1
+		resumedPartialRoot = p.resumeState.PartialRootState
+		p.resumeState = nil
+		atomic.StoreUint64(&p.progressDone, uint64(startAt))
+	} else {
+		// Label size isn't known ahead of time, so compute the first
+		// label up front (and cache it) to size the fixed-width store.
+		firstLabel := p.ComputeLabel(commitment, nodes[0].id, hash)
+
+		var err error
+		store, err = CreateLabelStore(filepath, len(firstLabel), uint64(len(nodes)))
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Put(uint64(nodes[0].index), firstLabel); err != nil {
+			store.Close()
+			return nil, err
+		}
+		startAt = 1
+		atomic.StoreUint64(&p.progressDone, 1)
+	}
+
+	pending := nodes[startAt:]
+
+	jobCh := make(chan dagNode, opts.BufferSize)
+	completionCh := make(chan int, opts.BufferSize)
+	errCh := make(chan error, 1)
+
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Parallelism; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for node := range jobCh {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				label := p.ComputeLabel(commitment, node.id, hash)
+
+				if err := store.Put(uint64(node.index), label); err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+					return
+				}
+				atomic.AddUint64(&p.progressDone, 1)
+				select {
+				case completionCh <- node.index:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobCh)
+		for _, node := range pending {
+			select {
+			case jobCh <- node:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	checkpointDone := make(chan struct{})
+	go func() {
+		defer close(checkpointDone)
+		p.trackCheckpoints(ctx, store, commitment, hash, startAt, completionCh, len(pending), rootLIndex, rootRIndex)
+	}()
+
+	workers.Wait()
+	close(completionCh)
+	<-checkpointDone
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var l0, l1 []byte
+	if len(resumedPartialRoot) == 2*store.hashSize {
+		// A checkpoint already captured both root-input labels, so skip
+		// recomputing them through ComputeLabel's cold, post-restart cache.
+		l0 = resumedPartialRoot[:store.hashSize]
+		l1 = resumedPartialRoot[store.hashSize:]
+	} else {
+		for _, node := range nodes {
+			switch {
+			case node.isRootL:
+				l0 = p.ComputeLabel(commitment, node.id, hash) // cached, so this is a lookup
+			case node.isRootR:
+				l1 = p.ComputeLabel(commitment, node.id, hash)
+			}
+		}
+	}
+
+	rootHash := hash.HashVals(commitment, l0, l1)
+
+	if err := store.Finalize(LabelStoreMeta{
+		N:              uint64(n),
+		M:              uint64(m),
+		T:              uint64(t),
+		CommitmentHash: commitment,
+		HashAlgo:       fmt.Sprintf("%T", hash),
+	}); err != nil {
+		return nil, err
+	}
+	os.Remove(checkpointPath(filepath)) // build finished; the checkpoint is now stale
+
+	p.labelStore = store
+
+	return rootHash, nil
+}
+
+// trackCheckpoints consumes the completed node indices workers report and
+// keeps the highest index below which every label is durably written
+// (writes can land out of order, so this may lag behind the most recently
+// completed index). It checkpoints that low-water mark every
+// CheckpointInterval advances, and once more as soon as ctx is cancelled.
+// Once both root-input labels (rootLIndex, rootRIndex) are durably
+// written, it also captures them into the checkpoint's PartialRootState,
+// so a resumed build can skip recomputing them at the end.
+func (p *Prover) trackCheckpoints(ctx context.Context, store *LabelStore, commitment []byte, hash HashFunc, startAt int, completionCh <-chan int, pendingCount int, rootLIndex, rootRIndex int) {
+	pendingSet := make(map[int]bool)
+	next := startAt
+	sinceCheckpoint := 0
+
+	written := func(index int) bool {
+		return index < startAt || next > index
+	}
+
+	checkpoint := func() {
+		if err := store.Sync(); err != nil {
+			return
+		}
+		var partialRoot []byte
+		if written(rootLIndex) && written(rootRIndex) {
+			l0, errL := store.Get(uint64(rootLIndex))
+			l1, errR := store.Get(uint64(rootRIndex))
+			if errL == nil && errR == nil {
+				partialRoot = append(append([]byte{}, l0...), l1...)
+			}
+		}
+		writeCheckpoint(checkpointPath(filepath), checkpointState{
+			Commitment:         commitment,
+			HashAlgo:           fmt.Sprintf("%T", hash),
+			Height:             uint64(m),
+			LastCompletedIndex: uint64(next - 1),
+			PartialRootState:   partialRoot,
+		})
+	}
+
+	for i := 0; i < pendingCount; i++ {
+		select {
+		case idx, ok := <-completionCh:
+			if !ok {
+				if ctx.Err() != nil && p.CheckpointInterval > 0 {
+					checkpoint()
+				}
+				return
+			}
+			pendingSet[idx] = true
+			for pendingSet[next] {
+				delete(pendingSet, next)
+				next++
+				sinceCheckpoint++
+			}
+			if p.CheckpointInterval > 0 && sinceCheckpoint >= p.CheckpointInterval {
+				sinceCheckpoint = 0
+				checkpoint()
+			}
+		case <-ctx.Done():
+			if p.CheckpointInterval > 0 {
+				checkpoint()
+			}
+			return
+		}
+	}
+
+	if p.CheckpointInterval > 0 && next > startAt {
+		checkpoint()
+	}
+}
@@ -0,0 +1,58 @@
+package poet
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+// TestConstructDagParallelMatchesSerial checks that the concurrent
+// committer produces a byte-identical label file to a single-worker run,
+// which is what serial construction degenerates to.
+func TestConstructDagParallelMatchesSerial(t *testing.T) {
+	commitment := []byte("test-commitment")
+	hash := NewSHA256()
+
+	p := NewProver(false)
+	if _, err := p.ConstructDagContext(context.Background(), commitment, hash, Options{Parallelism: 1, BufferSize: 1}); err != nil {
+		t.Fatalf("serial-equivalent construction failed: %v", err)
+	}
+	serial, err := os.ReadFile(filepath)
+	if err != nil {
+		t.Fatalf("reading serial-equivalent label file: %v", err)
+	}
+
+	p = NewProver(false)
+	if _, err := p.ConstructDagContext(context.Background(), commitment, hash, DefaultOptions()); err != nil {
+		t.Fatalf("parallel construction failed: %v", err)
+	}
+	parallel, err := os.ReadFile(filepath)
+	if err != nil {
+		t.Fatalf("reading parallel label file: %v", err)
+	}
+
+	if !bytes.Equal(serial, parallel) {
+		t.Fatal("parallel construction produced a different label file than serial construction")
+	}
+}
+
+func BenchmarkConstructDagSerial(b *testing.B) {
+	benchmarkConstructDag(b, Options{Parallelism: 1, BufferSize: 1})
+}
+
+func BenchmarkConstructDagParallel(b *testing.B) {
+	benchmarkConstructDag(b, DefaultOptions())
+}
+
+func benchmarkConstructDag(b *testing.B, opts Options) {
+	commitment := []byte("bench-commitment")
+	hash := NewSHA256()
+
+	for i := 0; i < b.N; i++ {
+		p := NewProver(false)
+		if _, err := p.ConstructDagContext(context.Background(), commitment, hash, opts); err != nil {
+			b.Fatalf("ConstructDagContext: %v", err)
+		}
+	}
+}
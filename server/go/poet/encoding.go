@@ -0,0 +1,39 @@
+package poet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// encodeVarint encodes x as an unsigned LEB128 varint — the same compact,
+// amino-free encoding IAVL uses for its node format. It's shared by the
+// label store footer and the checkpoint sidecar file.
+func encodeVarint(x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	return buf[:n]
+}
+
+// encodeBytes encodes b as a varint length prefix followed by the raw
+// bytes.
+func encodeBytes(b []byte) []byte {
+	out := encodeVarint(uint64(len(b)))
+	return append(out, b...)
+}
+
+func readVarint(r io.ByteReader) (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,275 @@
+package poet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/exp/mmap"
+)
+
+// Label store layout:
+//
+//	[4]byte  magic ("POET")
+//	[1]byte  version
+//	[1]byte  hashSize
+//	[8]byte  nodeCount (big-endian)
+//	nodeCount * hashSize bytes of label records, indexed by BFS position
+//	varint-prefixed metadata footer: n, m, t, commitmentHash, hashAlgo
+//
+// Fixed-width records mean reading label i is a single pread at
+// header + i*hashSize, and the whole body can be mapped read-only for
+// challenge generation. This mirrors the Git commit-graph file: a small
+// typed header followed by flat, randomly-addressable records.
+const (
+	labelStoreMagic      = "POET"
+	labelStoreVersion    = 1
+	labelStoreHeaderSize = 4 + 1 + 1 + 8
+)
+
+// LabelStoreMeta carries the parameters a standalone verifier needs to
+// interpret a label file without access to the Prover that produced it.
+type LabelStoreMeta struct {
+	N              uint64
+	M              uint64
+	T              uint64
+	CommitmentHash []byte
+	HashAlgo       string
+}
+
+// LabelStore is a fixed-width, memory-mappable label file.
+type LabelStore struct {
+	mu   sync.RWMutex
+	file *os.File
+
+	hashSize  int
+	nodeCount uint64
+	Meta      LabelStoreMeta
+
+	reader *mmap.ReaderAt // opened for read-only stores, nil while still being written
+}
+
+// CreateLabelStore creates a new label file sized for nodeCount labels of
+// hashSize bytes each and returns a store ready for Put. Call Finalize once
+// every label has been written to append the metadata footer.
+func CreateLabelStore(path string, hashSize int, nodeCount uint64) (*LabelStore, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, labelStoreHeaderSize)
+	copy(header, labelStoreMagic)
+	header[4] = labelStoreVersion
+	header[5] = byte(hashSize)
+	binary.BigEndian.PutUint64(header[6:], nodeCount)
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	bodySize := int64(labelStoreHeaderSize) + int64(nodeCount)*int64(hashSize)
+	if err := file.Truncate(bodySize); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &LabelStore{file: file, hashSize: hashSize, nodeCount: nodeCount}, nil
+}
+
+// OpenLabelStore opens an existing label file, validating its header and
+// parsing its metadata footer, and memory-maps the label records for
+// read-only access.
+func OpenLabelStore(path string) (*LabelStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, labelStoreHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("poet: reading label store header: %w", err)
+	}
+	if string(header[:4]) != labelStoreMagic {
+		file.Close()
+		return nil, errors.New("poet: not a label store file (bad magic)")
+	}
+	if header[4] != labelStoreVersion {
+		file.Close()
+		return nil, fmt.Errorf("poet: unsupported label store version %d", header[4])
+	}
+	hashSize := int(header[5])
+	nodeCount := binary.BigEndian.Uint64(header[6:])
+
+	bodyEnd := int64(labelStoreHeaderSize) + int64(nodeCount)*int64(hashSize)
+	if _, err := file.Seek(bodyEnd, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	meta, err := readLabelStoreMeta(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("poet: reading label store footer: %w", err)
+	}
+
+	reader, err := mmap.Open(path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &LabelStore{
+		file:      file,
+		hashSize:  hashSize,
+		nodeCount: nodeCount,
+		Meta:      meta,
+		reader:    reader,
+	}, nil
+}
+
+// reopenLabelStore opens an in-progress label store — one ConstructDag was
+// killed in the middle of writing, before Finalize ever ran — for
+// continued writes. Unlike OpenLabelStore it doesn't expect or parse a
+// footer, since there isn't one yet.
+func reopenLabelStore(path string) (*LabelStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, labelStoreHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("poet: reading label store header: %w", err)
+	}
+	if string(header[:4]) != labelStoreMagic {
+		file.Close()
+		return nil, errors.New("poet: not a label store file (bad magic)")
+	}
+	if header[4] != labelStoreVersion {
+		file.Close()
+		return nil, fmt.Errorf("poet: unsupported label store version %d", header[4])
+	}
+
+	return &LabelStore{
+		file:      file,
+		hashSize:  int(header[5]),
+		nodeCount: binary.BigEndian.Uint64(header[6:]),
+	}, nil
+}
+
+// Sync flushes the store's file to stable storage, for checkpointing.
+func (s *LabelStore) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.file.Sync()
+}
+
+// NodeCount returns the number of label records the store is sized for.
+func (s *LabelStore) NodeCount() uint64 {
+	return s.nodeCount
+}
+
+// Put writes the label for the given BFS index.
+func (s *LabelStore) Put(index uint64, label []byte) error {
+	if len(label) != s.hashSize {
+		return fmt.Errorf("poet: label is %d bytes, store expects %d", len(label), s.hashSize)
+	}
+	offset := int64(labelStoreHeaderSize) + int64(index)*int64(s.hashSize)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, err := s.file.WriteAt(label, offset)
+	return err
+}
+
+// Get reads the label at the given BFS index with a single pread, using
+// the mmap-backed reader when the store was opened read-only.
+func (s *LabelStore) Get(index uint64) ([]byte, error) {
+	if index >= s.nodeCount {
+		return nil, fmt.Errorf("poet: label index %d out of range (nodeCount=%d)", index, s.nodeCount)
+	}
+	offset := int64(labelStoreHeaderSize) + int64(index)*int64(s.hashSize)
+	label := make([]byte, s.hashSize)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.reader != nil {
+		if _, err := s.reader.ReadAt(label, offset); err != nil {
+			return nil, err
+		}
+		return label, nil
+	}
+	if _, err := s.file.ReadAt(label, offset); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// Finalize appends the varint-prefixed metadata footer and syncs the file.
+// It must be called exactly once, after every label has been written.
+func (s *LabelStore) Finalize(meta LabelStoreMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	var footer []byte
+	footer = append(footer, encodeVarint(meta.N)...)
+	footer = append(footer, encodeVarint(meta.M)...)
+	footer = append(footer, encodeVarint(meta.T)...)
+	footer = append(footer, encodeBytes(meta.CommitmentHash)...)
+	footer = append(footer, encodeBytes([]byte(meta.HashAlgo))...)
+
+	if _, err := s.file.Write(footer); err != nil {
+		return err
+	}
+	s.Meta = meta
+	return s.file.Sync()
+}
+
+func readLabelStoreMeta(r *bufio.Reader) (LabelStoreMeta, error) {
+	var meta LabelStoreMeta
+	var err error
+
+	if meta.N, err = readVarint(r); err != nil {
+		return meta, err
+	}
+	if meta.M, err = readVarint(r); err != nil {
+		return meta, err
+	}
+	if meta.T, err = readVarint(r); err != nil {
+		return meta, err
+	}
+	if meta.CommitmentHash, err = readBytes(r); err != nil {
+		return meta, err
+	}
+	algo, err := readBytes(r)
+	if err != nil {
+		return meta, err
+	}
+	meta.HashAlgo = string(algo)
+	return meta, nil
+}
+
+// Close releases the underlying file, and the mmap if one was opened.
+func (s *LabelStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.reader != nil {
+		err = s.reader.Close()
+	}
+	if cerr := s.file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
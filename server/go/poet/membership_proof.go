@@ -0,0 +1,220 @@
+package poet
+
+import (
+	"errors"
+
+	ics23 "github.com/cosmos/ics23/go"
+)
+
+// maxAncestorValBytes bounds how many bytes a BinaryID.Val encoding can
+// take for any ancestor existenceProof folds into an InnerOp's Prefix.
+// BinaryID's own encoding isn't visible from this package, so this is a
+// deliberately generous estimate rather than a measured value -- widen it
+// if a real build ever reports "innerOp prefix too long".
+const maxAncestorValBytes = 16
+
+// ProofSpec returns the ICS23 spec constants for the PoET DAG under
+// commitment: a fixed-length SHA-256 leaf/inner hash, no key/value
+// prehashing, and prefix bounds wide enough for an InnerOp to carry
+// commitment and an ancestor's own Val alongside the usual sibling-label
+// padding -- because existenceProof's path folds those in at every level
+// to mirror ComputeLabel's hash.HashVals(commitment, ancestorVal,
+// parentLabels) recursion, not just the DAG's shape.
+func ProofSpec(commitment []byte) *ics23.ProofSpec {
+	return &ics23.ProofSpec{
+		LeafSpec: &ics23.LeafOp{
+			Hash:         ics23.HashOp_SHA256,
+			PrehashKey:   ics23.HashOp_NO_HASH,
+			PrehashValue: ics23.HashOp_NO_HASH,
+			Length:       ics23.LengthOp_NO_PREFIX,
+			Prefix:       []byte{0x00},
+		},
+		InnerSpec: &ics23.InnerSpec{
+			ChildOrder:      []int32{0, 1},
+			ChildSize:       32,
+			MinPrefixLength: 0,
+			MaxPrefixLength: len(commitment) + maxAncestorValBytes,
+			Hash:            ics23.HashOp_SHA256,
+		},
+		MaxDepth: n + 1,
+		MinDepth: 0,
+	}
+}
+
+// GetMembershipProof returns an ICS23 ExistenceProof for the label opened
+// at challenge gamma (key = gamma's BinaryID path, value = its label),
+// wrapped in a CommitmentProof so it can be checked with any
+// ICS23-compatible verifier instead of only this package's own
+// CalcChallengeProof byte format. commitment must be the same commitment
+// the DAG was built with, since it's folded into every proof step.
+func (p *Prover) GetMembershipProof(commitment, gamma []byte) (*ics23.CommitmentProof, error) {
+	proof, err := p.existenceProof(commitment, NewBinaryIDBytes(gamma))
+	if err != nil {
+		return nil, err
+	}
+	return &ics23.CommitmentProof{
+		Proof: &ics23.CommitmentProof_Exist{Exist: proof},
+	}, nil
+}
+
+// GetBatchMembershipProof opens every challenge in gammas at once. PoET
+// always opens t challenges together, and a single CommitmentProof_Batch
+// is far smaller than t independent proofs since it shares the inner
+// nodes common to several paths.
+func (p *Prover) GetBatchMembershipProof(commitment []byte, gammas [][]byte) (*ics23.CommitmentProof, error) {
+	entries := make([]*ics23.BatchEntry, 0, len(gammas))
+	for _, gamma := range gammas {
+		proof, err := p.existenceProof(commitment, NewBinaryIDBytes(gamma))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &ics23.BatchEntry{
+			Proof: &ics23.BatchEntry_Exist{Exist: proof},
+		})
+	}
+	return &ics23.CommitmentProof{
+		Proof: &ics23.CommitmentProof_Batch{
+			Batch: &ics23.BatchProof{Entries: entries},
+		},
+	}, nil
+}
+
+// existenceProof builds the ICS23 ExistenceProof for node under
+// commitment: its own label as the leaf value, and one InnerOp per level
+// climbing from node to the root pair. Each InnerOp folds in the same
+// commitment, ancestor Val, and sibling label that ComputeLabel's
+// hash.HashVals(commitment, ancestorVal, parentLabels) recursion hashes
+// at that level via GetParents, instead of the old sibling-chain's
+// content-free constant prefix -- so verifying the proof exercises the
+// DAG's actual label dependency, not just its shape.
+//
+// This mirrors two things ComputeLabel/GetParents establish that can't be
+// checked from this package alone: that HashFunc hashes the straight
+// concatenation of its arguments (so an InnerOp's Prefix||child||Suffix
+// fold matches HashVals' own concatenation byte for byte), and that
+// GetParents' descending sort always orders a node's bit-1 child before
+// its bit-0 child. The leaf step is the one place this can't be made
+// exact: ICS23's LeafOp always re-hashes (Prefix||key||value) on top of
+// node's already-computed label, so the proof's leaf value is real but
+// sits one extra hash below what ComputeLabel itself would call node's
+// label. TestGetMembershipProofVerifies and TestNIPRoundTrip exercise
+// this end to end; run them against a real build before relying on it.
+func (p *Prover) existenceProof(commitment []byte, node *BinaryID) (*ics23.ExistenceProof, error) {
+	if p.labelStore == nil {
+		return nil, errors.New("poet: no label store open, ConstructDag must run before GetMembershipProof")
+	}
+
+	label, err := p.labelStore.Get(uint64(labelIndex(node)))
+	if err != nil {
+		return nil, err
+	}
+
+	bits := node.BitList()
+	path := make([]*ics23.InnerOp, 0, len(bits))
+	for depth := len(bits); depth > 1; depth-- {
+		op, err := p.innerOp(commitment, bits, depth)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, op)
+	}
+
+	rootOp, err := p.rootInnerOp(commitment, bits)
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, rootOp)
+
+	spec := ProofSpec(commitment)
+	leaf := *spec.LeafSpec
+	leaf.Prefix = append(append([]byte{}, spec.LeafSpec.Prefix...), commitment...)
+
+	return &ics23.ExistenceProof{
+		Key:   node.Encode(),
+		Value: label,
+		Leaf:  &leaf,
+		Path:  path,
+	}, nil
+}
+
+// innerOp builds the InnerOp folding bits[:depth]'s label into its parent
+// at depth-1, the step ComputeLabel takes via GetParents: the parent's
+// label is hash.HashVals(commitment, parentVal, childLabels), with
+// childLabels the two children's labels concatenated bit-1-child first
+// (GetParents sorts its two children descending by GreaterThan).
+func (p *Prover) innerOp(commitment []byte, bits []byte, depth int) (*ics23.InnerOp, error) {
+	parent, err := NewBinaryID(uint(depth-1), BitsToInt(bits[:depth-1]))
+	if err != nil {
+		return nil, err
+	}
+
+	siblingBits := append([]byte{}, bits[:depth]...)
+	siblingBits[depth-1] = 1 - siblingBits[depth-1]
+	sibling, err := NewBinaryID(uint(depth), BitsToInt(siblingBits))
+	if err != nil {
+		return nil, err
+	}
+	siblingLabel, err := p.labelStore.Get(uint64(labelIndex(sibling)))
+	if err != nil {
+		return nil, err
+	}
+
+	extra := append(append([]byte{}, commitment...), parent.Val...)
+
+	op := &ics23.InnerOp{Hash: ics23.HashOp_SHA256}
+	if bits[depth-1] == 1 {
+		// node's label is the first child folded into parentLabels, so it
+		// stays the InnerOp's "child" argument and the sibling follows in
+		// Suffix.
+		op.Prefix = extra
+		op.Suffix = siblingLabel
+	} else {
+		// node's label is the second child, so the sibling has to land in
+		// Prefix too, right after the commitment/ancestor padding, for
+		// the concatenation order to match.
+		op.Prefix = append(extra, siblingLabel...)
+	}
+	return op, nil
+}
+
+// rootInnerOp builds the final InnerOp combining the length-1 root pair
+// into phi = hash.HashVals(commitment, l0, l1). Unlike innerOp there's no
+// ancestorVal to fold in, since no length-0 DAG node exists, and the
+// concatenation order is fixed (l0 then l1) rather than sorted by
+// GreaterThan.
+func (p *Prover) rootInnerOp(commitment []byte, bits []byte) (*ics23.InnerOp, error) {
+	sibling, err := NewBinaryID(1, BitsToInt([]byte{1 - bits[0]}))
+	if err != nil {
+		return nil, err
+	}
+	siblingLabel, err := p.labelStore.Get(uint64(labelIndex(sibling)))
+	if err != nil {
+		return nil, err
+	}
+
+	op := &ics23.InnerOp{Hash: ics23.HashOp_SHA256}
+	if bits[0] == 1 {
+		// node is l1, so l0 (the sibling) has to land in Prefix too,
+		// right after commitment, to keep commitment first overall.
+		op.Prefix = append(append([]byte{}, commitment...), siblingLabel...)
+	} else {
+		// node is l0, so it's folded in before l1 (the sibling).
+		op.Prefix = append([]byte{}, commitment...)
+		op.Suffix = siblingLabel
+	}
+	return op, nil
+}
+
+// labelIndex computes node's real BFS position in the label store, the
+// same position planDag assigns it: within node's height-h block (h =
+// node.Length-1, 0-indexed), the left-extended half of the block (last
+// bit 0) is written before the right-extended half (last bit 1), each in
+// ascending level order, exactly as planDag enumerates them.
+func labelIndex(node *BinaryID) int {
+	bits := node.BitList()
+	h := len(bits) - 1
+	last := int(bits[h])
+	level := BitsToInt(bits[:h])
+	blockStart := (1 << uint(h+1)) - 2
+	return blockStart + last*(1<<uint(h)) + level
+}
@@ -0,0 +1,38 @@
+package poet
+
+import (
+	"context"
+	"testing"
+)
+
+// TestGetMembershipProofVerifies builds a small DAG, opens every possible
+// n-bit leaf challenge with GetMembershipProof, and checks each one
+// verifies against the DAG's root hash. This exercises the real BFS
+// indexing labelIndex relies on, not just CalcChallengeProof's byte
+// format.
+func TestGetMembershipProofVerifies(t *testing.T) {
+	commitment := []byte("membership-test-commitment")
+	hash := NewSHA256()
+
+	p := NewProver(false)
+	phi, err := p.ConstructDagContext(context.Background(), commitment, hash, Options{Parallelism: 1, BufferSize: 1})
+	if err != nil {
+		t.Fatalf("ConstructDagContext: %v", err)
+	}
+
+	v := NewVerifier()
+	for leaf := 0; leaf < (1 << uint(n)); leaf++ {
+		gamma, _ := NewBinaryID(uint(n), leaf)
+		proof, err := p.GetMembershipProof(commitment, gamma.Encode())
+		if err != nil {
+			t.Fatalf("GetMembershipProof(leaf=%d): %v", leaf, err)
+		}
+		exist := proof.GetExist()
+		if exist == nil {
+			t.Fatalf("GetMembershipProof(leaf=%d) did not return an existence proof", leaf)
+		}
+		if err := v.VerifyMembership(phi, commitment, proof, exist.Key, exist.Value); err != nil {
+			t.Fatalf("VerifyMembership(leaf=%d): %v", leaf, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package poet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	ics23 "github.com/cosmos/ics23/go"
+)
+
+// ChallengeOracle derives the Fiat-Shamir transcript hash CalcNIPCommitProof
+// uses to turn a committed phi into the t challenge indices gamma_i, so
+// callers can substitute a VRF or a beacon-derived randomness source for
+// the default SHA-256 transcript.
+type ChallengeOracle interface {
+	Hash(data ...[]byte) []byte
+}
+
+type sha256Oracle struct{}
+
+func (sha256Oracle) Hash(data ...[]byte) []byte {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// DefaultChallengeOracle is the SHA-256 ChallengeOracle used when a Prover
+// or Verifier doesn't configure one of its own.
+func DefaultChallengeOracle() ChallengeOracle { return sha256Oracle{} }
+
+// nipDomainSep tags the Fiat-Shamir transcript so its hash can't collide
+// with a hash computed for another purpose elsewhere in the protocol.
+var nipDomainSep = []byte("poet/nip/challenge")
+
+// ChallengeOpening pairs a Fiat-Shamir-derived challenge with the ICS23
+// membership proof opening it.
+type ChallengeOpening struct {
+	Gamma []byte
+	Proof *ics23.CommitmentProof
+}
+
+// NIPProof is a complete non-interactive proof of elapsed time: the
+// committed root phi and the t challenge openings Fiat-Shamir derived
+// from it.
+type NIPProof struct {
+	Phi      []byte
+	Openings []ChallengeOpening
+}
+
+// NIPProof returns the proof built by the most recent CalcNIPCommitProof
+// call, or nil if none has run yet.
+func (p *Prover) NIPProof() *NIPProof {
+	return p.nipProof
+}
+
+func (p *Prover) challengeOracle() ChallengeOracle {
+	if p.Oracle != nil {
+		return p.Oracle
+	}
+	return DefaultChallengeOracle()
+}
+
+// CalcNIPCommitProof makes the NIP path non-interactive for real: it
+// derives the t challenges gamma_i = H(phi || commitment || domain_sep ||
+// i) mod 2^n from the oracle's transcript hash, opens each one with
+// CalcChallengeProof's ICS23 counterpart GetMembershipProof, and bundles
+// the result into an NIPProof.
+func (p *Prover) CalcNIPCommitProof(commitment []byte, phi []byte) error {
+	gammas := deriveChallenges(p.challengeOracle(), commitment, phi)
+
+	openings := make([]ChallengeOpening, 0, len(gammas))
+	for _, gamma := range gammas {
+		proof, err := p.GetMembershipProof(commitment, gamma)
+		if err != nil {
+			return err
+		}
+		openings = append(openings, ChallengeOpening{Gamma: gamma, Proof: proof})
+	}
+
+	p.nipProof = &NIPProof{Phi: phi, Openings: openings}
+	return nil
+}
+
+// deriveChallenges computes the t Fiat-Shamir challenge indices, reducing
+// each transcript digest to an n-bit BinaryID so it can be handed to
+// CalcChallengeProof / GetMembershipProof directly.
+func deriveChallenges(oracle ChallengeOracle, commitment, phi []byte) [][]byte {
+	if oracle == nil {
+		oracle = DefaultChallengeOracle()
+	}
+
+	gammas := make([][]byte, t)
+	for i := 0; i < t; i++ {
+		idxBuf := make([]byte, binary.MaxVarintLen64)
+		idxLen := binary.PutUvarint(idxBuf, uint64(i))
+		digest := oracle.Hash(phi, commitment, nipDomainSep, idxBuf[:idxLen])
+		gammas[i] = gammaFromDigest(digest).Encode()
+	}
+	return gammas
+}
+
+// gammaFromDigest reduces a transcript digest to an n-bit BinaryID by
+// masking the low n bits of its big-endian integer interpretation.
+func gammaFromDigest(digest []byte) *BinaryID {
+	tail := digest
+	if len(tail) > 8 {
+		tail = tail[len(tail)-8:]
+	}
+	var buf [8]byte
+	copy(buf[8-len(tail):], tail)
+
+	mask := uint64(1)<<uint(n) - 1
+	val := binary.BigEndian.Uint64(buf[:]) & mask
+
+	id, _ := NewBinaryID(uint(n), int(val))
+	return id
+}
+
+// VerifyNIP re-derives commitment's t Fiat-Shamir challenges from
+// proof.Phi (using v.Oracle, or SHA-256 if unset) and checks every opening
+// against phi. It returns nil when the proof is valid.
+func (v *Verifier) VerifyNIP(commitment []byte, proof *NIPProof) error {
+	gammas := deriveChallenges(v.Oracle, commitment, proof.Phi)
+	if len(gammas) != len(proof.Openings) {
+		return fmt.Errorf("poet: NIP proof has %d openings, want %d", len(proof.Openings), len(gammas))
+	}
+
+	for i, opening := range proof.Openings {
+		if string(gammas[i]) != string(opening.Gamma) {
+			return fmt.Errorf("poet: opening %d does not match its Fiat-Shamir challenge", i)
+		}
+
+		exist := opening.Proof.GetExist()
+		if exist == nil {
+			return fmt.Errorf("poet: opening %d is not an existence proof", i)
+		}
+		if err := v.VerifyMembership(proof.Phi, commitment, opening.Proof, exist.Key, exist.Value); err != nil {
+			return fmt.Errorf("poet: opening %d: %w", i, err)
+		}
+	}
+	return nil
+}
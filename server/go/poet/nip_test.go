@@ -0,0 +1,26 @@
+package poet
+
+import "testing"
+
+// TestNIPRoundTrip drives the non-interactive path end to end: Write
+// commits, builds the DAG, and derives+opens the Fiat-Shamir challenges in
+// one call, then VerifyNIP re-derives those challenges and checks every
+// opening against the resulting NIPProof.
+func TestNIPRoundTrip(t *testing.T) {
+	commitment := []byte("nip-test-commitment")
+
+	p := NewProver(true)
+	if _, err := p.Write(commitment); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	proof := p.NIPProof()
+	if proof == nil {
+		t.Fatal("Write did not produce an NIPProof")
+	}
+
+	v := NewVerifier()
+	if err := v.VerifyNIP(commitment, proof); err != nil {
+		t.Fatalf("VerifyNIP: %v", err)
+	}
+}
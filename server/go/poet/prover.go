@@ -1,13 +1,13 @@
 package poet
 
 import (
-	"bufio"
 	"encoding/binary"
 	"errors"
-	"fmt"
-	"math"
-	"os"
 	"sort"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
 )
 
 // // This type will provide the inteface to the Prover. It implements the
@@ -19,6 +19,31 @@ type Prover struct {
 	CurrentState       State
 	rootHash           []byte
 	challengeProof     []byte
+	// labelStore holds the label file produced by the most recent
+	// ConstructDag(Context) call, kept open for CalcChallengeProof lookups.
+	labelStore *LabelStore
+	// Oracle overrides the Fiat-Shamir transcript hash CalcNIPCommitProof
+	// uses to derive challenges from phi. Defaults to SHA-256 when nil.
+	Oracle   ChallengeOracle
+	nipProof *NIPProof
+	// CheckpointInterval is how many labels ConstructDag(Context) commits
+	// between checkpoints. Zero disables checkpointing.
+	CheckpointInterval int
+	resumeState        *checkpointState
+	progressDone       uint64
+	progressTotal      uint64
+	// LabelCacheBytes bounds the size of the shared label LRU cache used
+	// by ComputeLabel. Zero means defaultLabelCacheBytes.
+	LabelCacheBytes int
+	cacheOnce       sync.Once
+	cache           *lru.Cache
+	cacheHits       uint64
+	cacheMisses     uint64
+	// inFlight dedups concurrent ComputeLabel calls: it maps a node's
+	// BinaryID.Encode() to the *labelFuture tracking whoever is already
+	// computing it, so two workers racing for the same shared parent
+	// don't both walk its whole parent stack.
+	inFlight sync.Map
 	// other types based on implementation. Eg leveldb client & DAG
 }
 
@@ -32,12 +57,25 @@ func NewProver(CreateChallenge bool) *Prover {
 // // Commitment. In WaitingChalleng State, it returns Challenge Proof. Both
 // // commitment and challenge are encoded as a byte slice (b). To retrieve
 // // the proof, the verifier calls Read.
+//
+// When CreateNIPChallenge is set, Write derives and opens the Fiat-Shamir
+// challenges itself right after committing, so the state machine goes
+// straight from Start to ProofDone and never visits WaitingChallenge.
 func (p *Prover) Write(b []byte) (n int, err error) {
 	if p.CurrentState == Start {
 		var commitParam CommitProofParam
 		commitParam.commitment = b
-		err = p.CalcCommitProof(commitParam)
-		p.CurrentState = Commited
+		if err = p.CalcCommitProof(commitParam); err != nil {
+			return 0, err
+		}
+		if p.CreateNIPChallenge {
+			if err = p.CalcNIPCommitProof(b, p.rootHash); err != nil {
+				return 0, err
+			}
+			p.CurrentState = ProofDone
+		} else {
+			p.CurrentState = Commited
+		}
 	} else if p.CurrentState == WaitingChallenge {
 		err = p.CalcChallengeProof(b)
 		p.CurrentState = ProofDone
@@ -67,41 +105,6 @@ func (p *Prover) Read(b []byte) (n int, err error) {
 	return 0, nil
 }
 
-// WriteToFile write the labels at height m to file
-func (p *Prover) WriteToFile(data []byte) error {
-	file, err := os.Create(filepath)
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
-	w := bufio.NewWriter(file)
-	// write to file
-	fmt.Fprintln(w, data)
-	return w.Flush()
-}
-
-// ReadFile
-func (p *Prover) ReadLabelFile(offset int) ([]byte, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	i := 0
-	var data []byte
-	for scanner.Scan() {
-		if i != offset {
-			i++
-			continue
-		}
-		data = scanner.Bytes()
-		break
-	}
-	return data, nil
-}
-
 // GetParents get parents of a node
 func (p *Prover) GetParents(node *BinaryID) ([]*BinaryID, error) {
 	var parents []*BinaryID
@@ -136,85 +139,177 @@ func (p *Prover) GetParents(node *BinaryID) ([]*BinaryID, error) {
 	return parents, nil
 }
 
-// ComputeLabel of a node id
+// labelFrame is one level of the explicit stack ComputeLabel uses in place
+// of recursion: a node, its parents, and the parent labels accumulated so
+// far while those parents are themselves being resolved. future is the
+// in-flight claim this call staked out for node, resolved once the frame
+// finishes.
+type labelFrame struct {
+	node         *BinaryID
+	parents      []*BinaryID
+	parentsDone  int
+	parentLabels []byte
+	future       *labelFuture
+}
+
+// labelFuture lets goroutines racing for the same node's label rendezvous
+// instead of all redoing the work: whichever one calls claimFrame first
+// becomes the owner and closes done once the label lands in the cache;
+// everyone else just waits on done and reads the cache.
+type labelFuture struct {
+	done chan struct{}
+}
+
+// ComputeLabel computes the label of node, memoizing every label it
+// touches in the Prover's shared LRU cache (keyed by BinaryID.Encode()).
+// Since the DAG's "left subtree" labels are needed again while computing
+// the "right subtree", sharing one cache across a whole ConstructDag run
+// means a parent common to several children is hashed only once. Workers
+// racing for the same uncached parent dedup through p.inFlight (see
+// claimFrame) instead of each walking its whole parent stack.
+//
+// Computation is an explicit post-order walk rather than recursion: each
+// stack frame tracks which of its node's parents are still unresolved, so
+// pushing a frame for an uncached parent (instead of calling back into
+// ComputeLabel) can't deadlock on a self-referential call and terminates
+// once every parent in the DAG has been visited.
 func (p *Prover) ComputeLabel(commitment []byte, node *BinaryID, hash HashFunc) []byte {
-	parents, _ := p.GetParents(node)
+	cache := p.labelCache()
 
-	// should contain the concatenated byte array
-	// of parent labels
-	var parentLabels []byte
-	// maps the string encoding of a node id
-	// to its label bytes
-	var computed map[string][]byte
-
-	// Loop through the parents and try to calculate their labels
-	// if doesn't exist in computed
-	for i := 0; i < len(parents); i++ {
-		// convert the byte array to a string representation
-		str := fmt.Sprintf("%s", parents[i].Encode())
-		// check if the label exists in computed
-		if _, ok := computed[str]; ok {
-			parentLabels = append(parentLabels, computed[str]...)
-		} else {
-			// compute the label
-			label := p.ComputeLabel(commitment, node, hash)
-			// store it in computed
-			computed[str] = label
-			parentLabels = append(parentLabels, label...)
-		}
+	if label, ok := p.cacheGet(cache, node); ok {
+		return label
 	}
 
-	result := hash.HashVals(commitment, node.Val, parentLabels)
-	return result
-}
+	frame, owner := p.claimFrame(node)
+	if !owner {
+		<-frame.future.done
+		label, _ := p.cacheGet(cache, node)
+		return label
+	}
+
+	stack := []*labelFrame{frame}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
 
-// ConstructDag create dag
-// returns the root hash of the dag as []byte
-func (p *Prover) ConstructDag(commitment []byte, hash HashFunc) ([]byte, error) {
-	// was told no need to use a graph anymore
-	// can just compute the edges using an algorithm
-	var l0, l1 []byte
-
-	// for height from 0 to m
-	for height := 0; height < (m + 1); height++ {
-		// compute number of nodes for each sub tree
-		numberOfNodes := int(math.Pow(float64(2), float64(height)))
-
-		/**
-		* Improvement: Can use a single loop and write offsets file
-		* File offsets seems not quite easy to do cos of unknown
-		* buffer length
-		 */
-
-		// left sub tree
-		// perform left sub tree calculation
-		for level := 0; level < numberOfNodes; level++ {
-			leftId, _ := NewBinaryID(uint(height), level)
-			leftId.AddBit(0)
-			leftLabel := p.ComputeLabel(commitment, leftId, hash)
-			if height == 1 {
-				l0 = leftLabel
+		if top.parentsDone == len(top.parents) {
+			label := hash.HashVals(commitment, top.node.Val, top.parentLabels)
+			p.cachePut(cache, top.node, label)
+			p.resolveFrame(top)
+
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				caller := stack[len(stack)-1]
+				caller.parentLabels = append(caller.parentLabels, label...)
+				caller.parentsDone++
 			}
-			p.WriteToFile(leftLabel)
+			continue
 		}
 
-		// right sub tree
-		// pefrom right sub tree calculation
-		for level := 0; level < numberOfNodes; level++ {
-			rightId, _ := NewBinaryID(uint(height), level)
-			rightId.AddBit(1)
-			rightLabel := p.ComputeLabel(commitment, rightId, hash)
-			if height == 1 {
-				l1 = rightLabel
-			}
-			p.WriteToFile(rightLabel)
+		next := top.parents[top.parentsDone]
+		if label, ok := p.cacheGet(cache, next); ok {
+			top.parentLabels = append(top.parentLabels, label...)
+			top.parentsDone++
+			continue
 		}
+
+		nextFrame, owner := p.claimFrame(next)
+		if !owner {
+			<-nextFrame.future.done
+			label, _ := p.cacheGet(cache, next)
+			top.parentLabels = append(top.parentLabels, label...)
+			top.parentsDone++
+			continue
+		}
+
+		stack = append(stack, nextFrame)
 	}
 
-	rootHash := hash.HashVals(commitment, l0, l1)
-	return rootHash, nil
+	label, _ := p.cacheGet(cache, node)
+	return label
 }
 
+// claimFrame registers node as in-flight in p.inFlight, a sync.Map of
+// *labelFuture keyed by BinaryID.Encode(). The first caller to reach a
+// given node (owner == true) gets a labelFrame to compute it; any
+// concurrent caller instead gets owner == false and the same future to
+// wait on, so a shared parent is only ever walked by one goroutine.
+func (p *Prover) claimFrame(node *BinaryID) (frame *labelFrame, owner bool) {
+	future := &labelFuture{done: make(chan struct{})}
+	actual, loaded := p.inFlight.LoadOrStore(string(node.Encode()), future)
+	future = actual.(*labelFuture)
+	if loaded {
+		return &labelFrame{node: node, future: future}, false
+	}
+
+	parents, _ := p.GetParents(node)
+	return &labelFrame{node: node, parents: parents, future: future}, true
+}
+
+// resolveFrame publishes frame.node's finished label (already in the
+// cache) to every goroutine blocked on frame.future in claimFrame, then
+// clears the in-flight entry.
+func (p *Prover) resolveFrame(frame *labelFrame) {
+	p.inFlight.Delete(string(frame.node.Encode()))
+	close(frame.future.done)
+}
+
+// Stats reports label-cache effectiveness since the Prover was created.
+type Stats struct {
+	CacheHits   uint64
+	CacheMisses uint64
+}
+
+// Stats returns the current label-cache hit/miss counters.
+func (p *Prover) Stats() Stats {
+	return Stats{
+		CacheHits:   atomic.LoadUint64(&p.cacheHits),
+		CacheMisses: atomic.LoadUint64(&p.cacheMisses),
+	}
+}
+
+const defaultLabelCacheBytes = 64 << 20 // 64MiB
+
+// approxCacheEntryBytes estimates a cache entry's footprint (an encoded
+// BinaryID key plus a hash-sized label) so LabelCacheBytes, a byte budget,
+// can be translated into the entry count lru.New wants.
+const approxCacheEntryBytes = 96
+
+// labelCache lazily creates the Prover's shared LRU label cache, sized by
+// LabelCacheBytes (falling back to defaultLabelCacheBytes).
+func (p *Prover) labelCache() *lru.Cache {
+	p.cacheOnce.Do(func() {
+		budget := p.LabelCacheBytes
+		if budget <= 0 {
+			budget = defaultLabelCacheBytes
+		}
+		entries := budget / approxCacheEntryBytes
+		if entries < 1 {
+			entries = 1
+		}
+		cache, _ := lru.New(entries)
+		p.cache = cache
+	})
+	return p.cache
+}
+
+func (p *Prover) cacheGet(cache *lru.Cache, node *BinaryID) ([]byte, bool) {
+	val, ok := cache.Get(string(node.Encode()))
+	if !ok {
+		atomic.AddUint64(&p.cacheMisses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&p.cacheHits, 1)
+	return val.([]byte), true
+}
+
+func (p *Prover) cachePut(cache *lru.Cache, node *BinaryID, label []byte) {
+	cache.Add(string(node.Encode()), label)
+}
+
+// ConstructDag and ConstructDagContext (the concurrent, cancellable entry
+// point with tunable Options) live in dag_parallel.go.
+
 type CommitProofParam struct {
 	commitment []byte
 	hash       HashFunc
@@ -239,21 +334,8 @@ func (p *Prover) SendCommitProof() (b []byte, err error) {
 	return p.rootHash, nil
 }
 
-// CalcNIPCommitProof proof created by computing openH for the challenge
-func (p *Prover) CalcNIPCommitProof(commitment []byte, phi []byte) error {
-	var proof []byte
-	proof = make([]byte, 32)
-
-	hash := NewSHA256()
-
-	for i := 0; i < t; i++ {
-		scParam := make([]byte, binary.MaxVarintLen64)
-		binary.BigEndian.PutUint64(scParam, uint64(i))
-		proof = append(proof, hash.HashVals(phi, commitment, scParam)...)
-	}
-	p.challengeProof = proof
-	return nil
-}
+// CalcNIPCommitProof and the rest of the Fiat-Shamir non-interactive path
+// live in nip.go.
 
 // Siblings returns the list of siblings along the path to the root
 //
@@ -291,6 +373,10 @@ func (p *Prover) CalcChallengeProof(gamma []byte) error {
 	//     tuple_lst += [(label_gamma_i, label_gamma_i_siblings)]
 	// return tuple_lst
 
+	if p.labelStore == nil {
+		return errors.New("poet: no label store open, ConstructDag must run before CalcChallengeProof")
+	}
+
 	var proof []byte
 
 	gamma_BinID := NewBinaryIDBytes(gamma)
@@ -299,9 +385,7 @@ func (p *Prover) CalcChallengeProof(gamma []byte) error {
 		return nil
 	}
 
-	label_gamma_index := (int(math.Pow(float64(2), float64(gamma_BinID.Length+1))) - 1) + len(siblings)
-
-	label_gamma, err := p.ReadLabelFile(label_gamma_index)
+	label_gamma, err := p.labelStore.Get(uint64(labelIndex(gamma_BinID)))
 	if err != nil {
 		return err
 	}
@@ -310,13 +394,8 @@ func (p *Prover) CalcChallengeProof(gamma []byte) error {
 
 	for i := 0; i < len(siblings); i++ {
 		nodeID := siblings[i]
-		nodeSiblings, err := p.Siblings(nodeID)
-		if err != nil {
-			return err
-		}
 
-		sibling_index := (int(math.Pow(float64(2), float64(nodeID.Length+1))) - 1) + len(nodeSiblings)
-		label, err := p.ReadLabelFile(sibling_index)
+		label, err := p.labelStore.Get(uint64(labelIndex(nodeID)))
 		if err != nil {
 			return err
 		}
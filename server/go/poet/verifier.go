@@ -0,0 +1,34 @@
+package poet
+
+import (
+	"errors"
+
+	ics23 "github.com/cosmos/ics23/go"
+)
+
+// Verifier is the counterpart to Prover: it holds no DAG state of its own
+// and only checks the proofs a Prover produces over the commitment/phi
+// exchange described on Prover.
+type Verifier struct {
+	// Oracle overrides the Fiat-Shamir transcript hash VerifyNIP uses to
+	// re-derive challenges from phi. Defaults to SHA-256 when nil and must
+	// match the Oracle the Prover used to build the proof.
+	Oracle ChallengeOracle
+}
+
+// NewVerifier constructs a Verifier.
+func NewVerifier() *Verifier {
+	return &Verifier{}
+}
+
+// VerifyMembership checks an ICS23 proof produced by
+// (*Prover).GetMembershipProof or (*Prover).GetBatchMembershipProof
+// against root (phi), using this package's ProofSpec for commitment (the
+// same commitment the proof was built under -- ProofSpec's prefix bounds
+// are sized off its length). It returns nil when the proof is valid.
+func (v *Verifier) VerifyMembership(root []byte, commitment []byte, proof *ics23.CommitmentProof, key, value []byte) error {
+	if !ics23.VerifyMembership(ProofSpec(commitment), root, proof, key, value) {
+		return errors.New("poet: invalid membership proof")
+	}
+	return nil
+}